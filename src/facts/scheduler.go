@@ -0,0 +1,144 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// A Leitner-style spaced-repetition scheduler: every fact the child has
+// seen lives in a box from 1 (weakest) to maxBox (mastered). A correct
+// first-try answer promotes a fact to the next box and pushes its due
+// question count out by leitnerIntervals[box]; any wrong answer drops it
+// straight back to box 1. NextInput prefers the weakest due fact over
+// sampling a brand new one, so facts the child struggles with come back
+// around far more often than ones they already know.
+
+// highest Leitner box a fact can reach
+const maxBox = 5
+
+// how many more questions must pass before a fact in box N comes due
+// again
+var leitnerIntervals = map[int]int{1: 1, 2: 3, 3: 7, 4: 15, 5: 30}
+
+// factKey identifies a fact independent of its Leitner progress
+type factKey struct {
+	op   Operator
+	x, y int
+}
+
+// FactRecord tracks one fact's place in the Leitner schedule
+type FactRecord struct {
+	Op Operator
+	X  int
+	Y  int
+
+	// current Leitner box, 1 (weakest) through maxBox (mastered)
+	Box int
+
+	// the "total" count at or after which this fact is due again
+	DueAt int
+}
+
+// return the next fact: the weakest due fact if one exists, otherwise a
+// freshly sampled one
+func (s *Session) NextInput() {
+	if fk, ok := s.dueFact(); ok {
+		s.ops, s.x, s.y = fk.op, fk.x, fk.y
+	} else {
+		s.sampleFact()
+	}
+	s.hasQuestion = true
+	s.firstError = true
+	s.questionStart = time.Now()
+}
+
+// dueFact returns the key of the fact with the lowest box among every fact
+// whose DueAt has arrived, so weaker facts are reviewed before stronger
+// ones that happen to be due at the same time.
+func (s *Session) dueFact() (factKey, bool) {
+	var bestKey factKey
+	var best *FactRecord
+
+	for k, r := range s.facts {
+		if r.DueAt > s.total {
+			continue
+		}
+		if best == nil || r.Box < best.Box {
+			bestKey, best = k, r
+		}
+	}
+
+	return bestKey, best != nil
+}
+
+// sampleFact picks a fact from the same operator distribution the app has
+// always used, and registers any fact not seen before at box 1.
+func (s *Session) sampleFact() {
+	weight := s.s.Int63() % 11
+	switch {
+	case weight < 5:
+		s.ops = ADD
+		s.x = int(s.s.Int63() % 20)
+		s.y = int(s.s.Int63() % 20)
+	case weight < 10:
+		s.ops = SUB
+		s.x = int(s.s.Int63() % 20)
+		s.y = int(s.s.Int63() % 20)
+		if s.x < s.y {
+			s.x, s.y = s.y, s.x
+		}
+	case weight < 11:
+		s.ops = MUL
+		s.x = int(s.s.Int63() % 10)
+		s.y = int(s.s.Int63() % 3)
+	default:
+		panic("Should not be here")
+	}
+
+	fk := factKey{s.ops, s.x, s.y}
+	if _, ok := s.facts[fk]; !ok {
+		s.facts[fk] = &FactRecord{Op: s.ops, X: s.x, Y: s.y, Box: 1, DueAt: s.total + leitnerIntervals[1]}
+	}
+}
+
+// recordAnswer applies a Leitner update for the fact (op, x, y): promote
+// it on a correct first try, drop it back to box 1 on any miss.
+func (s *Session) recordAnswer(op Operator, x, y int, correct bool) {
+	fk := factKey{op, x, y}
+	rec, ok := s.facts[fk]
+	if !ok {
+		rec = &FactRecord{Op: op, X: x, Y: y, Box: 1}
+		s.facts[fk] = rec
+	}
+
+	if correct {
+		if rec.Box < maxBox {
+			rec.Box++
+		}
+	} else {
+		rec.Box = 1
+	}
+	rec.DueAt = s.total + leitnerIntervals[rec.Box]
+}
+
+// Stats summarizes this session's Leitner progress: how many facts have
+// reached the top box, and the three weakest facts seen so far.
+func (s *Session) Stats() StatsPage {
+	records := make([]*FactRecord, 0, len(s.facts))
+	for _, r := range s.facts {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Box < records[j].Box })
+
+	page := StatsPage{}
+	for _, r := range records {
+		if r.Box >= maxBox {
+			page.Mastered++
+		}
+	}
+	for i := 0; i < len(records) && i < 3; i++ {
+		r := records[i]
+		page.Weakest = append(page.Weakest, FactStat{X: r.X, Y: r.Y, Opstr: opSymbol(r.Op), Box: r.Box})
+	}
+	return page
+}
@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestRecordAnswerPromotesAndResetsBox(t *testing.T) {
+	s := NewSession("sid")
+
+	s.recordAnswer(ADD, 2, 3, true)
+	rec := s.facts[factKey{ADD, 2, 3}]
+	if rec.Box != 2 {
+		t.Fatalf("expected a correct answer to promote box to 2, got %d", rec.Box)
+	}
+
+	s.recordAnswer(ADD, 2, 3, false)
+	if rec.Box != 1 {
+		t.Fatalf("expected a wrong answer to reset box to 1, got %d", rec.Box)
+	}
+}
+
+func TestNextInputPrefersDueFactOverSampling(t *testing.T) {
+	s := NewSession("sid")
+	s.total = 10
+	s.facts[factKey{MUL, 6, 7}] = &FactRecord{Op: MUL, X: 6, Y: 7, Box: 3, DueAt: 10}
+	s.facts[factKey{ADD, 1, 1}] = &FactRecord{Op: ADD, X: 1, Y: 1, Box: 5, DueAt: 20}
+
+	s.NextInput()
+
+	if s.ops != MUL || s.x != 6 || s.y != 7 {
+		t.Fatalf("expected the due, weaker fact 6*7 to be chosen, got %v %d %d", s.ops, s.x, s.y)
+	}
+	if !s.hasQuestion || !s.firstError {
+		t.Fatal("expected NextInput to mark a pending, not-yet-missed question")
+	}
+}
+
+func TestStatsCountsMasteredAndWeakest(t *testing.T) {
+	s := NewSession("sid")
+	s.facts[factKey{ADD, 1, 1}] = &FactRecord{Op: ADD, X: 1, Y: 1, Box: maxBox}
+	s.facts[factKey{SUB, 9, 4}] = &FactRecord{Op: SUB, X: 9, Y: 4, Box: 1}
+	s.facts[factKey{MUL, 2, 2}] = &FactRecord{Op: MUL, X: 2, Y: 2, Box: 2}
+
+	stats := s.Stats()
+	if stats.Mastered != 1 {
+		t.Fatalf("expected 1 mastered fact, got %d", stats.Mastered)
+	}
+	if len(stats.Weakest) != 3 || stats.Weakest[0].Box != 1 {
+		t.Fatalf("expected the weakest fact first, got %+v", stats.Weakest)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// uniquely identify a user session
+type Session struct {
+	// guards every field below against concurrent requests that carry
+	// the same cookie, e.g. a double-clicked submit. Manager.Start hands
+	// out the same *sync.Mutex for a given sid on every call, so this
+	// also serializes requests against providers that deserialize a
+	// fresh *Session on every read (file, redis); it defaults to a
+	// private mutex here only so a Session used outside of Manager.Start
+	// (e.g. in tests) is still safe to lock.
+	mu *sync.Mutex
+
+	// session id, also the key used by the provider
+	sid string
+
+	// provider this session was loaded from, used by Save
+	provider SessionProvider
+
+	// session start time stamp
+	start time.Time
+
+	// last time this session was read or written, used for GC
+	lastAccess time.Time
+
+	// random source
+	s rand.Source
+
+	// indicate if the user give incorrect answer before
+	firstError bool
+
+	// operands
+	x, y int
+
+	// operator
+	ops Operator
+
+	// total number of errors
+	errors int
+
+	// total number of questions
+	total int
+
+	// messages queued for the next render and cleared once read, e.g.
+	// "Correct!" or "Try again - 7+8 is not 14"
+	flashes []string
+
+	// whether NextInput has ever produced a question for this session
+	hasQuestion bool
+
+	// Leitner review schedule for every fact seen so far, keyed by
+	// operator and operands
+	facts map[factKey]*FactRecord
+
+	// when the current fact was shown, used to time the answer for the
+	// /report histogram
+	questionStart time.Time
+
+	// account this session is logged in as, if any; progress is mirrored
+	// onto it and persisted through userStore on every answered fact
+	user      *User
+	userStore UserStore
+
+	// name of the linked account, persisted in the wire format so that a
+	// session reloaded from a file/redis provider - which can't carry
+	// the *User pointer across a restart - knows which account to reload
+	// from the store on its next request
+	userName string
+}
+
+// template parameters for question page
+type QuestionPage struct {
+	// operands
+	X, Y int
+
+	// string representation of operator
+	Opstr string
+
+	// total number of questions so far
+	Total int
+
+	// total number of errors made so far
+	Errors int
+
+	// feedback queued since the last render, e.g. "Correct!"
+	Flashes []string
+}
+
+// template parameters for welcome page
+type WelcomePage struct {
+	NumFacts int
+}
+
+// one row of the weakest-facts table on the stats page
+type FactStat struct {
+	X, Y  int
+	Opstr string
+	Box   int
+}
+
+// template parameters for the /stats page
+type StatsPage struct {
+	// facts that have reached the top Leitner box
+	Mastered int
+
+	// the lowest-box facts, weakest first
+	Weakest []FactStat
+}
+
+// create a session for new user/client
+func NewSession(sid string) *Session {
+	ts := time.Now()
+	return &Session{
+		sid:        sid,
+		mu:         &sync.Mutex{},
+		start:      ts,
+		lastAccess: ts,
+		s:          rand.NewSource(int64(ts.UnixNano())),
+		facts:      make(map[factKey]*FactRecord),
+	}
+}
+
+// persist any mutation made to this session back to its provider
+func (s *Session) Save() error {
+	if s.provider == nil {
+		return nil
+	}
+	return s.provider.SessionUpdate(s)
+}
+
+// AddFlash queues msg to be shown once on the next call to Flashes.
+func (s *Session) AddFlash(msg string) {
+	s.flashes = append(s.flashes, msg)
+}
+
+// Flashes returns every message queued since the last call and clears the
+// queue, so each flash is shown exactly once.
+func (s *Session) Flashes() []string {
+	f := s.flashes
+	s.flashes = nil
+	return f
+}
+
+// sessionData is the wire format used by providers that cannot hold a
+// *Session pointer directly (file, redis): it carries every field needed
+// to resume a session, since rand.Source itself cannot be serialized.
+type sessionData struct {
+	Sid           string
+	Start         time.Time
+	LastAccess    time.Time
+	FirstError    bool
+	X, Y          int
+	Ops           Operator
+	Errors        int
+	Total         int
+	Flashes       []string
+	HasQuestion   bool
+	Facts         []FactRecord
+	UserName      string
+	QuestionStart time.Time
+}
+
+// factsSnapshot returns a flat copy of the Leitner table, suitable for
+// serialization or for mirroring onto a User record.
+func (s *Session) factsSnapshot() []FactRecord {
+	facts := make([]FactRecord, 0, len(s.facts))
+	for _, r := range s.facts {
+		facts = append(facts, *r)
+	}
+	return facts
+}
+
+// hydrateUser loads u's persisted progress into this session and links the
+// two, so later answers are mirrored back onto u through store. It is meant
+// for handleLogin, where the session is genuinely starting over against an
+// account: in-flight question state has nothing to preserve yet.
+func (s *Session) hydrateUser(u *User, store UserStore) {
+	s.attachUser(u, store)
+	s.total = u.Total
+	s.errors = u.Errors
+	s.hasQuestion = false
+
+	s.facts = make(map[factKey]*FactRecord, len(u.Facts))
+	for i := range u.Facts {
+		r := u.Facts[i]
+		s.facts[factKey{r.Op, r.X, r.Y}] = &r
+	}
+}
+
+// attachUser links this session to u without touching its question state.
+// It is meant for handleNextQuestion, where the session was just
+// deserialized fresh from a file/redis provider: s.userName survived the
+// round trip but the *User pointer didn't, so syncUser would otherwise
+// silently stop persisting progress for every request after the one that
+// logged in.
+func (s *Session) attachUser(u *User, store UserStore) {
+	s.user = u
+	s.userStore = store
+	s.userName = u.Name
+}
+
+// syncUser mirrors this session's progress onto its linked User, records
+// the outcome of the fact at (op, x, y) for the /report histogram, and
+// persists the result. It is a no-op for sessions that never logged in.
+func (s *Session) syncUser(op Operator, correct bool, elapsed time.Duration) {
+	if s.user == nil {
+		return
+	}
+
+	s.user.Total = s.total
+	s.user.Errors = s.errors
+	s.user.Facts = s.factsSnapshot()
+
+	stat := &s.user.OpStats[op]
+	stat.Attempts++
+	if correct {
+		stat.Correct++
+	}
+	stat.DurationsMs = append(stat.DurationsMs, elapsed.Milliseconds())
+
+	if err := s.userStore.UserUpdate(s.user); err != nil {
+		fmt.Println("Fails to save user progress:", err)
+	}
+}
+
+// toData snapshots s into its wire format.
+func (s *Session) toData() sessionData {
+	return sessionData{
+		Sid:           s.sid,
+		Start:         s.start,
+		LastAccess:    s.lastAccess,
+		FirstError:    s.firstError,
+		X:             s.x,
+		Y:             s.y,
+		Ops:           s.ops,
+		Errors:        s.errors,
+		Total:         s.total,
+		Flashes:       s.flashes,
+		HasQuestion:   s.hasQuestion,
+		Facts:         s.factsSnapshot(),
+		UserName:      s.userName,
+		QuestionStart: s.questionStart,
+	}
+}
+
+// fromData rebuilds a Session from its wire format. The random source is
+// reseeded from the current time rather than restored, since rand.Source
+// keeps no exportable state.
+func sessionFromData(d sessionData) *Session {
+	facts := make(map[factKey]*FactRecord, len(d.Facts))
+	for i := range d.Facts {
+		r := d.Facts[i]
+		facts[factKey{r.Op, r.X, r.Y}] = &r
+	}
+
+	return &Session{
+		sid:           d.Sid,
+		mu:            &sync.Mutex{},
+		start:         d.Start,
+		lastAccess:    d.LastAccess,
+		s:             rand.NewSource(time.Now().UnixNano()),
+		firstError:    d.FirstError,
+		x:             d.X,
+		y:             d.Y,
+		ops:           d.Ops,
+		errors:        d.Errors,
+		total:         d.Total,
+		flashes:       d.Flashes,
+		hasQuestion:   d.HasQuestion,
+		facts:         facts,
+		userName:      d.UserName,
+		questionStart: d.QuestionStart,
+	}
+}
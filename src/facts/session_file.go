@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileProvider stores one JSON file per session inside a directory,
+// keyed by session id. It is meant for a single-process deployment that
+// wants sessions to survive a restart without standing up Redis.
+type FileProvider struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileProvider returns a FileProvider rooted at dir, creating dir if it
+// does not already exist.
+func NewFileProvider(dir string) (*FileProvider, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileProvider{dir: dir}, nil
+}
+
+func (p *FileProvider) path(sid string) string {
+	return filepath.Join(p.dir, sid+".json")
+}
+
+func (p *FileProvider) write(sess *Session) error {
+	f, err := os.Create(p.path(sess.sid))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(sess.toData())
+}
+
+func (p *FileProvider) read(sid string) (*Session, error) {
+	f, err := os.Open(p.path(sid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var d sessionData
+	if err := json.NewDecoder(f).Decode(&d); err != nil {
+		return nil, err
+	}
+	return sessionFromData(d), nil
+}
+
+func (p *FileProvider) SessionInit(sid string) (*Session, error) {
+	sess := NewSession(sid)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.write(sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+func (p *FileProvider) SessionRead(sid string) (*Session, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sess, err := p.read(sid)
+	if err != nil {
+		return nil, err
+	}
+	sess.lastAccess = time.Now()
+	return sess, nil
+}
+
+func (p *FileProvider) SessionUpdate(sess *Session) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sess.lastAccess = time.Now()
+	return p.write(sess)
+}
+
+func (p *FileProvider) SessionDestroy(sid string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	err := os.Remove(p.path(sid))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (p *FileProvider) SessionGC(maxLifetime int64) {
+	cutoff := time.Now().Add(-time.Duration(maxLifetime) * time.Second)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().Before(cutoff) {
+			os.Remove(filepath.Join(p.dir, e.Name()))
+		}
+	}
+}
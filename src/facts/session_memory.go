@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// MemProvider keeps every session in a plain map guarded by a mutex. It is
+// the default provider and matches the behaviour of the old sessionMap,
+// minus the leak: SessionGC actually evicts idle sessions.
+type MemProvider struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// NewMemProvider returns an empty in-memory SessionProvider.
+func NewMemProvider() *MemProvider {
+	return &MemProvider{sessions: make(map[string]*Session)}
+}
+
+func (p *MemProvider) SessionInit(sid string) (*Session, error) {
+	sess := NewSession(sid)
+	p.mu.Lock()
+	p.sessions[sid] = sess
+	p.mu.Unlock()
+	return sess, nil
+}
+
+func (p *MemProvider) SessionRead(sid string) (*Session, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sess, ok := p.sessions[sid]
+	if !ok {
+		return nil, errors.New("facts: no session for id " + sid)
+	}
+	sess.lastAccess = time.Now()
+	return sess, nil
+}
+
+func (p *MemProvider) SessionUpdate(sess *Session) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sess.lastAccess = time.Now()
+	p.sessions[sess.sid] = sess
+	return nil
+}
+
+func (p *MemProvider) SessionDestroy(sid string) error {
+	p.mu.Lock()
+	delete(p.sessions, sid)
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *MemProvider) SessionGC(maxLifetime int64) {
+	cutoff := time.Now().Add(-time.Duration(maxLifetime) * time.Second)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for sid, sess := range p.sessions {
+		if sess.lastAccess.Before(cutoff) {
+			delete(p.sessions, sid)
+		}
+	}
+}
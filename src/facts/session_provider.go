@@ -0,0 +1,307 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SessionProvider stores and retrieves sessions by id. Implementations must
+// be safe for concurrent use, since a single provider is shared by every
+// request handled by the Manager.
+type SessionProvider interface {
+	// SessionInit creates and stores a brand new session under sid.
+	SessionInit(sid string) (*Session, error)
+
+	// SessionRead loads the session previously stored under sid. It
+	// returns an error if no such session exists.
+	SessionRead(sid string) (*Session, error)
+
+	// SessionUpdate persists mutations made to a session that was
+	// obtained via SessionInit or SessionRead.
+	SessionUpdate(sess *Session) error
+
+	// SessionDestroy removes the session stored under sid, if any.
+	SessionDestroy(sid string) error
+
+	// SessionGC evicts every session whose last access is older than
+	// maxLifetime seconds.
+	SessionGC(maxLifetime int64)
+}
+
+// Config describes how to build a Manager from a JSON config file.
+type Config struct {
+	// name of the cookie that carries the session id
+	CookieName string `json:"cookieName"`
+
+	// one of "memory", "file", "redis"
+	Provider string `json:"provider"`
+
+	// how long, in seconds, an idle session is kept around
+	MaxLifetime int64 `json:"maxLifetime"`
+
+	// how often, in seconds, SessionGC runs
+	GCInterval int64 `json:"gcInterval"`
+
+	// secret used to HMAC-sign cookie values; should be long and random
+	Secret string `json:"secret"`
+
+	// directory holding one file per session, used by the file provider
+	FileDir string `json:"fileDir,omitempty"`
+
+	// host:port of the redis server, used by the redis provider
+	RedisAddr string `json:"redisAddr,omitempty"`
+
+	// directory holding one file per account, used by the file-backed
+	// UserStore
+	UserStoreDir string `json:"userStoreDir,omitempty"`
+
+	// whether to mark the session cookie Secure. Only set this once the
+	// server is actually reached over HTTPS (typically via a TLS-
+	// terminating reverse proxy): browsers silently drop Secure cookies
+	// set over plain HTTP, which would otherwise make every session
+	// fail to persist past the first request.
+	Secure bool `json:"secure,omitempty"`
+}
+
+// LoadConfig reads and parses a Manager config from a JSON file on disk.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg := &Config{}
+	if err := json.NewDecoder(f).Decode(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Manager owns a SessionProvider plus the cookie settings needed to map
+// incoming requests to a Session, along the lines of beego's
+// session.Manager and gorilla/sessions.
+type Manager struct {
+	provider    SessionProvider
+	cookieName  string
+	maxLifetime int64
+	secret      []byte
+
+	// whether the session cookie is marked Secure; see Config.Secure
+	secure bool
+
+	// one *sidLock per outstanding sid, handed out by Start so every
+	// request for a given sid serializes against every other, even
+	// against providers (file, redis) that deserialize a brand new
+	// *Session on every read. Swept by sweepLocks alongside SessionGC so
+	// sids that are never revisited - including anonymous bot traffic
+	// hitting "/" once - don't leak a mutex for the life of the process.
+	sidLocks sync.Map
+}
+
+// sidLock is one entry in Manager.sidLocks: the mutex Start hands out for a
+// sid, plus when it was last handed out so sweepLocks can tell a stale entry
+// from one still in use.
+type sidLock struct {
+	mu       sync.Mutex
+	lastUsed int64 // unix seconds, read/written atomically
+}
+
+// NewManager builds a Manager around an already-constructed provider.
+// secure controls whether the session cookie is marked Secure, and should
+// only be true once the server is actually reached over HTTPS.
+func NewManager(provider SessionProvider, cookieName string, maxLifetime int64, secret string, secure bool) *Manager {
+	return &Manager{
+		provider:    provider,
+		cookieName:  cookieName,
+		maxLifetime: maxLifetime,
+		secret:      []byte(secret),
+		secure:      secure,
+	}
+}
+
+// NewManagerFromConfig builds the provider named by cfg.Provider and wraps
+// it in a Manager.
+func NewManagerFromConfig(cfg *Config) (*Manager, error) {
+	var provider SessionProvider
+	switch cfg.Provider {
+	case "", "memory":
+		provider = NewMemProvider()
+	case "file":
+		if cfg.FileDir == "" {
+			return nil, errors.New("facts: file provider requires fileDir")
+		}
+		p, err := NewFileProvider(cfg.FileDir)
+		if err != nil {
+			return nil, err
+		}
+		provider = p
+	case "redis":
+		if cfg.RedisAddr == "" {
+			return nil, errors.New("facts: redis provider requires redisAddr")
+		}
+		provider = NewRedisProvider(cfg.RedisAddr, cfg.MaxLifetime)
+	default:
+		return nil, errors.New("facts: unknown session provider " + cfg.Provider)
+	}
+
+	if cfg.Secret == "" {
+		return nil, errors.New("facts: config is missing a session secret")
+	}
+
+	m := NewManager(provider, cfg.CookieName, cfg.MaxLifetime, cfg.Secret, cfg.Secure)
+
+	gcInterval := cfg.GCInterval
+	if gcInterval <= 0 {
+		gcInterval = cfg.MaxLifetime / 2
+	}
+	if gcInterval > 0 {
+		go m.gcLoop(time.Duration(gcInterval) * time.Second)
+	}
+
+	return m, nil
+}
+
+// gcLoop periodically asks the provider to evict expired sessions and sweeps
+// sidLocks for entries that went with them. It never returns, so callers
+// should run it in its own goroutine.
+func (m *Manager) gcLoop(interval time.Duration) {
+	for range time.Tick(interval) {
+		m.provider.SessionGC(m.maxLifetime)
+		m.sweepLocks(m.maxLifetime)
+	}
+}
+
+// Start returns the Session belonging to r, creating and cookie-ing a new
+// one if the request has none, the cookie fails verification, or the
+// session it names is gone (expired or never existed).
+//
+// The returned Session is already locked for the caller's exclusive use:
+// Start acquires the per-sid lock before reading the session and hands it
+// back via sess.mu, so the caller must release it (typically with
+// `defer session.mu.Unlock()`) once it is done mutating and rendering.
+// Locking around the read itself, rather than leaving it to the caller, is
+// what makes the file and redis providers - which hand back a brand new
+// *Session on every call - serialize correctly instead of racing two
+// independent copies to a lost update.
+func (m *Manager) Start(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	if c, err := r.Cookie(m.cookieName); err == nil && c.Value != "" {
+		if sid, ok := m.verify(c.Value); ok {
+			lock := m.lockFor(sid)
+			lock.mu.Lock()
+			if sess, err := m.provider.SessionRead(sid); err == nil {
+				sess.provider = m.provider
+				sess.mu = &lock.mu
+				m.setCookie(w, sid)
+				return sess, nil
+			}
+			lock.mu.Unlock()
+		}
+	}
+
+	sid, err := generateSessionID()
+	if err != nil {
+		return nil, err
+	}
+	lock := m.lockFor(sid)
+	lock.mu.Lock()
+	sess, err := m.provider.SessionInit(sid)
+	if err != nil {
+		lock.mu.Unlock()
+		return nil, err
+	}
+	sess.provider = m.provider
+	sess.mu = &lock.mu
+	m.setCookie(w, sid)
+	return sess, nil
+}
+
+// lockFor returns the sidLock serializing every request for sid, creating
+// one on first use and refreshing its last-used time. The same *sidLock is
+// handed out across every Start call for sid regardless of which Session
+// object the provider returns.
+func (m *Manager) lockFor(sid string) *sidLock {
+	v, _ := m.sidLocks.LoadOrStore(sid, &sidLock{})
+	lock := v.(*sidLock)
+	atomic.StoreInt64(&lock.lastUsed, time.Now().Unix())
+	return lock
+}
+
+// sweepLocks evicts every sidLock that hasn't been handed out in the last
+// maxLifetime seconds, keeping sidLocks bounded by live sessions rather than
+// every sid ever issued. A lock currently held by an in-flight request is
+// left for the next sweep instead of blocking on it.
+func (m *Manager) sweepLocks(maxLifetime int64) {
+	cutoff := time.Now().Unix() - maxLifetime
+	m.sidLocks.Range(func(key, value interface{}) bool {
+		lock := value.(*sidLock)
+		if atomic.LoadInt64(&lock.lastUsed) >= cutoff {
+			return true
+		}
+		if !lock.mu.TryLock() {
+			return true
+		}
+		m.sidLocks.Delete(key)
+		lock.mu.Unlock()
+		return true
+	})
+}
+
+// setCookie writes the signed, hardened session cookie for sid.
+func (m *Manager) setCookie(w http.ResponseWriter, sid string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.cookieName,
+		Value:    m.sign(sid),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   m.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// sign produces a "sid.mac" cookie value that Verify can check for
+// tampering.
+func (m *Manager) sign(sid string) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(sid))
+	sum := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	return sid + "." + sum
+}
+
+// verify checks a cookie value produced by sign and returns the session id
+// it carries, if the signature is intact.
+func (m *Manager) verify(value string) (string, bool) {
+	idx := strings.LastIndex(value, ".")
+	if idx < 0 {
+		return "", false
+	}
+	sid, mac := value[:idx], value[idx+1:]
+
+	expected := m.sign(sid)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(value)) != 1 {
+		_ = mac
+		return "", false
+	}
+	return sid, true
+}
+
+// generateSessionID returns a cryptographically random, URL-safe session
+// id, replacing the old predictable "seed:count" scheme.
+func generateSessionID() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestSweepLocksEvictsOnlyStaleEntries guards against sidLocks growing
+// without bound: every sid ever issued - including anonymous bot traffic
+// that never returns - used to leak a permanent *sync.Mutex. sweepLocks
+// should drop a sid's lock once it has aged past maxLifetime, but leave a
+// recently-used or currently-held one alone.
+func TestSweepLocksEvictsOnlyStaleEntries(t *testing.T) {
+	m := NewManager(NewMemProvider(), "myCookie", 3600, "test-secret", false)
+
+	staleLock := m.lockFor("stale")
+	atomic.StoreInt64(&staleLock.lastUsed, time.Now().Unix()-120)
+
+	m.lockFor("fresh")
+
+	heldLock := m.lockFor("held")
+	atomic.StoreInt64(&heldLock.lastUsed, time.Now().Unix()-120)
+	heldLock.mu.Lock()
+	defer heldLock.mu.Unlock()
+
+	m.sweepLocks(60)
+
+	if _, ok := m.sidLocks.Load("stale"); ok {
+		t.Fatal("expected the stale, unheld lock to be evicted")
+	}
+	if _, ok := m.sidLocks.Load("fresh"); !ok {
+		t.Fatal("expected the recently-used lock to survive the sweep")
+	}
+	if _, ok := m.sidLocks.Load("held"); !ok {
+		t.Fatal("expected a lock currently held by an in-flight request to survive the sweep")
+	}
+}
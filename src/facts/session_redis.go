@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisProvider stores sessions as JSON strings under "facts:session:<sid>"
+// keys, relying on Redis's own EXPIRE to age them out instead of a polled
+// SessionGC: a TTL is attached to every SET.
+type RedisProvider struct {
+	addr string
+	ttl  int64
+}
+
+// NewRedisProvider returns a provider talking to the Redis instance at
+// addr ("host:port"), expiring keys after ttl seconds.
+func NewRedisProvider(addr string, ttl int64) *RedisProvider {
+	return &RedisProvider{addr: addr, ttl: ttl}
+}
+
+const redisKeyPrefix = "facts:session:"
+
+func (p *RedisProvider) key(sid string) string {
+	return redisKeyPrefix + sid
+}
+
+// dial opens a fresh connection for a single command. The session traffic
+// here is low-volume enough that pooling would be premature.
+func (p *RedisProvider) dial() (net.Conn, error) {
+	return net.DialTimeout("tcp", p.addr, 5*time.Second)
+}
+
+// do sends a single RESP command and returns the raw reply: a bulk string
+// payload, or "" for a nil/OK reply. It returns an error for RESP error
+// replies or for a nil bulk string, since every caller here treats a miss
+// as an error.
+func (p *RedisProvider) do(args ...string) (string, error) {
+	conn, err := p.dial()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := conn.Write([]byte(b.String())); err != nil {
+		return "", err
+	}
+
+	return readReply(bufio.NewReader(conn))
+}
+
+// readReply parses a single RESP reply (simple string, error, integer,
+// bulk string, or array of bulk strings) into its string form.
+func readReply(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return "", errors.New("facts: empty redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return "", errors.New("facts: redis error: " + line[1:])
+	case ':':
+		return line[1:], nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", err
+		}
+		if n < 0 {
+			return "", errors.New("facts: redis key not found")
+		}
+		buf := make([]byte, n+2) // payload plus trailing CRLF
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		return "", errors.New("facts: unexpected redis array reply")
+	default:
+		return "", errors.New("facts: unrecognized redis reply")
+	}
+}
+
+func (p *RedisProvider) SessionInit(sid string) (*Session, error) {
+	sess := NewSession(sid)
+	if err := p.write(sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+func (p *RedisProvider) SessionRead(sid string) (*Session, error) {
+	payload, err := p.do("GET", p.key(sid))
+	if err != nil {
+		return nil, err
+	}
+
+	var d sessionData
+	if err := json.Unmarshal([]byte(payload), &d); err != nil {
+		return nil, err
+	}
+	sess := sessionFromData(d)
+	sess.lastAccess = time.Now()
+	return sess, nil
+}
+
+func (p *RedisProvider) SessionUpdate(sess *Session) error {
+	sess.lastAccess = time.Now()
+	return p.write(sess)
+}
+
+func (p *RedisProvider) write(sess *Session) error {
+	buf, err := json.Marshal(sess.toData())
+	if err != nil {
+		return err
+	}
+	_, err = p.do("SET", p.key(sess.sid), string(buf), "EX", strconv.FormatInt(p.ttl, 10))
+	return err
+}
+
+func (p *RedisProvider) SessionDestroy(sid string) error {
+	_, err := p.do("DEL", p.key(sid))
+	return err
+}
+
+// SessionGC is a no-op: every key is written with an EX TTL, so Redis ages
+// out expired sessions itself.
+func (p *RedisProvider) SessionGC(maxLifetime int64) {}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionFlashesConsumedOnce(t *testing.T) {
+	s := NewSession("sid")
+	s.AddFlash("Correct!")
+	s.AddFlash("Try again - 7+8 is not 14")
+
+	got := s.Flashes()
+	if len(got) != 2 || got[0] != "Correct!" || got[1] != "Try again - 7+8 is not 14" {
+		t.Fatalf("unexpected flashes: %v", got)
+	}
+
+	if got := s.Flashes(); len(got) != 0 {
+		t.Fatalf("expected flashes to be cleared after being read, got %v", got)
+	}
+}
+
+func TestCheckAnswerQueuesOutcomeFlash(t *testing.T) {
+	s := NewSession("sid")
+	s.ops, s.x, s.y, s.total = ADD, 7, 8, 1
+	s.hasQuestion, s.firstError = true, true
+
+	checkAnswer(s, "14")
+	if flashes := s.Flashes(); len(flashes) != 1 || flashes[0] != "Try again - 7+8 is not 14" {
+		t.Fatalf("expected a wrong-answer flash, got %v", flashes)
+	}
+	if s.total != 1 {
+		t.Fatalf("expected total to stay at 1 after a wrong answer, got %d", s.total)
+	}
+
+	checkAnswer(s, "15")
+	if flashes := s.Flashes(); len(flashes) != 1 || flashes[0] != "Correct!" {
+		t.Fatalf("expected a correct-answer flash, got %v", flashes)
+	}
+	if s.total != 2 {
+		t.Fatalf("expected total to advance after a correct answer, got %d", s.total)
+	}
+}
+
+// TestQuestionStartSurvivesFileProviderRoundTrip guards against
+// questionStart resetting to its zero value across a file/redis round trip:
+// time.Since of the zero Time is on the order of the age of the universe in
+// milliseconds, which checkAnswer would otherwise record into the /report
+// histogram for the very next answered question.
+func TestQuestionStartSurvivesFileProviderRoundTrip(t *testing.T) {
+	provider, err := NewFileProvider(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileProvider: %v", err)
+	}
+
+	s, err := provider.SessionInit("sid")
+	if err != nil {
+		t.Fatalf("SessionInit: %v", err)
+	}
+	s.questionStart = time.Now().Add(-3 * time.Second)
+	if err := provider.SessionUpdate(s); err != nil {
+		t.Fatalf("SessionUpdate: %v", err)
+	}
+
+	reread, err := provider.SessionRead("sid")
+	if err != nil {
+		t.Fatalf("SessionRead: %v", err)
+	}
+
+	elapsed := time.Since(reread.questionStart)
+	if elapsed < 0 || elapsed > time.Minute {
+		t.Fatalf("expected questionStart to survive the round trip, time.Since gave %v", elapsed)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// User is a child's account: credentials plus the cumulative progress that
+// should survive past any one browser or Session.
+type User struct {
+	Name         string
+	PasswordHash string
+
+	// cumulative counters, mirrored from Session on every answered fact
+	Total  int
+	Errors int
+
+	// Leitner schedule, carried over so a returning child resumes where
+	// they left off instead of redrilling mastered facts
+	Facts []FactRecord
+
+	// per-operator accuracy and answer-time history, used by /report
+	OpStats [NUMOPS]OpStat
+}
+
+// OpStat tracks one operator's accuracy and answer-time history for a User.
+type OpStat struct {
+	Attempts int
+	Correct  int
+
+	// how long each answered question took, in milliseconds
+	DurationsMs []int64
+}
+
+// UserStore creates and persists accounts, keyed by name.
+type UserStore interface {
+	// UserCreate registers a brand new account. It fails if name is
+	// already taken.
+	UserCreate(name, passwordHash string) (*User, error)
+
+	// UserRead loads the account stored under name.
+	UserRead(name string) (*User, error)
+
+	// UserUpdate persists mutations made to a User obtained from this
+	// store.
+	UserUpdate(u *User) error
+}
+
+// validUserName matches the only names UserStore implementations are
+// allowed to see. FileUserStore turns a name straight into a filename
+// (name+".json"), so every caller accepting a name from a request
+// (handleRegister, handleLogin, handleReport) must check it against this
+// before it ever reaches the store - otherwise a name like "../evil"
+// escapes the store's directory via path traversal.
+var validUserName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// KNOWN DEVIATION, NEEDS SIGN-OFF: the request for this subsystem asked for
+// bcrypt. This tree has no go.mod and vendors nothing, so
+// golang.org/x/crypto/bcrypt isn't available to import, and password
+// hashing is the kind of security-sensitive code that shouldn't get a
+// silent stdlib substitute. hashPassword/verifyPassword below are a
+// salted, iterated-SHA256 KDF instead - flagging this explicitly rather
+// than passing it off as equivalent. Once this repo can vendor
+// dependencies, swap this for bcrypt and migrate any stored hashes.
+
+// passwordHashRounds is how many times the salted password is rehashed,
+// standing in for a real KDF (bcrypt/scrypt) that this dependency-free
+// build can't import.
+const passwordHashRounds = 100000
+
+// hashPassword salts and iteratively hashes password, returning a string
+// safe to store and later check with verifyPassword.
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	sum := derivePassword(password, salt)
+	return base64.RawURLEncoding.EncodeToString(salt) + "$" + base64.RawURLEncoding.EncodeToString(sum), nil
+}
+
+// verifyPassword checks password against a hash produced by hashPassword.
+func verifyPassword(password, encoded string) bool {
+	salt, want, ok := splitPasswordHash(encoded)
+	if !ok {
+		return false
+	}
+	got := derivePassword(password, salt)
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+func splitPasswordHash(encoded string) (salt, sum []byte, ok bool) {
+	parts := strings.SplitN(encoded, "$", 2)
+	if len(parts) != 2 {
+		return nil, nil, false
+	}
+	salt, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, false
+	}
+	sum, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, false
+	}
+	return salt, sum, true
+}
+
+func derivePassword(password string, salt []byte) []byte {
+	sum := sha256.Sum256(append(salt, []byte(password)...))
+	for i := 0; i < passwordHashRounds; i++ {
+		sum = sha256.Sum256(sum[:])
+	}
+	return sum[:]
+}
+
+var errInvalidCredentials = errors.New("facts: invalid name or password")
+
+// authenticate looks up name in store and checks password against its
+// stored hash.
+func authenticate(store UserStore, name, password string) (*User, error) {
+	u, err := store.UserRead(name)
+	if err != nil {
+		return nil, errInvalidCredentials
+	}
+	if !verifyPassword(password, u.PasswordHash) {
+		return nil, errInvalidCredentials
+	}
+	return u, nil
+}
+
+// one operator's row on the /report page
+type OpReport struct {
+	Opstr    string
+	Attempts int
+	Correct  int
+
+	// percentage of attempts answered correctly
+	Accuracy float64
+
+	Histogram []HistogramBucket
+}
+
+// one bar of the time-per-question histogram
+type HistogramBucket struct {
+	Label string
+	Count int
+}
+
+// template parameters for the /report page
+type ReportPage struct {
+	User string
+	Ops  []OpReport
+}
+
+// answer-time bucket boundaries, in milliseconds
+var histogramBoundsMs = []int64{2000, 5000, 10000}
+
+var histogramLabels = []string{"<2s", "2-5s", "5-10s", ">10s"}
+
+// buildReport summarizes u's per-operator accuracy and answer-time spread.
+func buildReport(u *User) ReportPage {
+	page := ReportPage{User: u.Name}
+	for op := Operator(0); op < NUMOPS; op++ {
+		stat := u.OpStats[op]
+
+		var accuracy float64
+		if stat.Attempts > 0 {
+			accuracy = float64(stat.Correct) / float64(stat.Attempts) * 100
+		}
+
+		page.Ops = append(page.Ops, OpReport{
+			Opstr:     opSymbol(op),
+			Attempts:  stat.Attempts,
+			Correct:   stat.Correct,
+			Accuracy:  accuracy,
+			Histogram: bucketDurations(stat.DurationsMs),
+		})
+	}
+	return page
+}
+
+// bucketDurations counts each duration into one of histogramLabels.
+func bucketDurations(durationsMs []int64) []HistogramBucket {
+	counts := make([]int, len(histogramLabels))
+	for _, d := range durationsMs {
+		i := 0
+		for i < len(histogramBoundsMs) && d >= histogramBoundsMs[i] {
+			i++
+		}
+		counts[i]++
+	}
+
+	buckets := make([]HistogramBucket, len(histogramLabels))
+	for i, label := range histogramLabels {
+		buckets[i] = HistogramBucket{Label: label, Count: counts[i]}
+	}
+	return buckets
+}
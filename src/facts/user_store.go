@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// KNOWN DEVIATION, NEEDS SIGN-OFF: the request for this subsystem asked for
+// a BoltDB/SQLite default UserStore. Neither is vendored in this
+// dependency-free tree, so FileUserStore below is a plain JSON-file-per-
+// account store instead, reached through the same UserStore interface a
+// real KV/SQL-backed implementation would be. It has none of BoltDB's
+// atomicity or SQLite's query support - flagging that explicitly rather
+// than presenting it as a drop-in equivalent. Swap it out once this repo
+// can vendor dependencies.
+
+// FileUserStore stores one JSON file per account inside a directory, keyed
+// by name. It is the default UserStore: the store a real deployment would
+// swap for BoltDB or SQLite is reached through the same interface.
+type FileUserStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileUserStore returns a FileUserStore rooted at dir, creating dir if
+// it does not already exist.
+func NewFileUserStore(dir string) (*FileUserStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileUserStore{dir: dir}, nil
+}
+
+func (s *FileUserStore) path(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
+
+func (s *FileUserStore) write(u *User) error {
+	f, err := os.Create(s.path(u.Name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(u)
+}
+
+func (s *FileUserStore) UserCreate(name, passwordHash string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := os.Stat(s.path(name)); err == nil {
+		return nil, errors.New("facts: user already exists: " + name)
+	}
+
+	u := &User{Name: name, PasswordHash: passwordHash}
+	if err := s.write(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (s *FileUserStore) UserRead(name string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.path(name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	u := &User{}
+	if err := json.NewDecoder(f).Decode(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (s *FileUserStore) UserUpdate(u *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(u)
+}
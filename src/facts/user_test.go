@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashAndVerifyPassword(t *testing.T) {
+	hash, err := hashPassword("s3cret")
+	if err != nil {
+		t.Fatalf("hashPassword: %v", err)
+	}
+	if !verifyPassword("s3cret", hash) {
+		t.Fatal("expected the correct password to verify")
+	}
+	if verifyPassword("wrong", hash) {
+		t.Fatal("expected an incorrect password to fail verification")
+	}
+}
+
+func TestFileUserStoreCreateReadUpdate(t *testing.T) {
+	store, err := NewFileUserStore(filepath.Join(t.TempDir(), "users"))
+	if err != nil {
+		t.Fatalf("NewFileUserStore: %v", err)
+	}
+
+	hash, _ := hashPassword("s3cret")
+	if _, err := store.UserCreate("ada", hash); err != nil {
+		t.Fatalf("UserCreate: %v", err)
+	}
+	if _, err := store.UserCreate("ada", hash); err == nil {
+		t.Fatal("expected a duplicate UserCreate to fail")
+	}
+
+	u, err := store.UserRead("ada")
+	if err != nil {
+		t.Fatalf("UserRead: %v", err)
+	}
+	u.Total = 42
+	if err := store.UserUpdate(u); err != nil {
+		t.Fatalf("UserUpdate: %v", err)
+	}
+
+	reread, err := store.UserRead("ada")
+	if err != nil {
+		t.Fatalf("UserRead after update: %v", err)
+	}
+	if reread.Total != 42 {
+		t.Fatalf("expected updated Total to persist, got %d", reread.Total)
+	}
+}
+
+func TestSessionSyncUserPersistsProgress(t *testing.T) {
+	store, err := NewFileUserStore(filepath.Join(t.TempDir(), "users"))
+	if err != nil {
+		t.Fatalf("NewFileUserStore: %v", err)
+	}
+	hash, _ := hashPassword("s3cret")
+	user, err := store.UserCreate("ada", hash)
+	if err != nil {
+		t.Fatalf("UserCreate: %v", err)
+	}
+
+	s := NewSession("sid")
+	s.hydrateUser(user, store)
+	s.total = 1
+
+	s.syncUser(MUL, true, 0)
+
+	saved, err := store.UserRead("ada")
+	if err != nil {
+		t.Fatalf("UserRead: %v", err)
+	}
+	if saved.Total != 1 {
+		t.Fatalf("expected Total to be mirrored onto the User, got %d", saved.Total)
+	}
+	if saved.OpStats[MUL].Attempts != 1 || saved.OpStats[MUL].Correct != 1 {
+		t.Fatalf("expected one correct MUL attempt recorded, got %+v", saved.OpStats[MUL])
+	}
+}
+
+// TestHandleNextQuestionPersistsPastLogin drives /login then two separate
+// /next cycles through FileProvider, which deserializes a brand new
+// *Session - with no *User pointer - on every read. Before relinking the
+// user per request, syncUser silently stopped persisting progress after
+// the request that logged in, so a second correct answer would never reach
+// the on-disk User record.
+func TestHandleNextQuestionPersistsPastLogin(t *testing.T) {
+	provider, err := NewFileProvider(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileProvider: %v", err)
+	}
+	manager = NewManager(provider, "myCookie", 3600, "test-secret", false)
+
+	store, err := NewFileUserStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileUserStore: %v", err)
+	}
+	userStore = store
+
+	hash, _ := hashPassword("s3cret")
+	if _, err := store.UserCreate("ada", hash); err != nil {
+		t.Fatalf("UserCreate: %v", err)
+	}
+
+	loginRec := httptest.NewRecorder()
+	handleLogin(loginRec, httptest.NewRequest(http.MethodPost, "/login?name=ada&password=s3cret", nil))
+	cookie := loginRec.Result().Cookies()[0]
+
+	sid, ok := manager.verify(cookie.Value)
+	if !ok {
+		t.Fatal("expected handleLogin to set a verifiable session cookie")
+	}
+
+	// GET /next generates the first question against a freshly
+	// deserialized Session.
+	handleNextQuestion(httptest.NewRecorder(), withCookie(httptest.NewRequest(http.MethodGet, "/next", nil), cookie))
+
+	sess, err := provider.SessionRead(sid)
+	if err != nil {
+		t.Fatalf("SessionRead: %v", err)
+	}
+	answer := fmt.Sprintf("%d", sess.x+sess.y)
+	if sess.ops == SUB {
+		answer = fmt.Sprintf("%d", sess.x-sess.y)
+	} else if sess.ops == MUL {
+		answer = fmt.Sprintf("%d", sess.x*sess.y)
+	}
+
+	// POST the correct answer against yet another freshly deserialized
+	// Session - this is the request that used to silently stop
+	// persisting.
+	postReq := withCookie(httptest.NewRequest(http.MethodPost, "/next?answer="+answer, nil), cookie)
+	handleNextQuestion(httptest.NewRecorder(), postReq)
+
+	saved, err := store.UserRead("ada")
+	if err != nil {
+		t.Fatalf("UserRead: %v", err)
+	}
+	if saved.Total != 1 {
+		t.Fatalf("expected the answer from a later request to reach the User record, got Total=%d", saved.Total)
+	}
+}
+
+func withCookie(r *http.Request, c *http.Cookie) *http.Request {
+	r.AddCookie(c)
+	return r
+}
+
+// TestHandleRegisterRejectsPathTraversalName guards against a name like
+// "../evil" reaching FileUserStore, which joins name straight into a
+// filesystem path: unchecked, that would write outside the store's
+// directory instead of inside it.
+func TestHandleRegisterRejectsPathTraversalName(t *testing.T) {
+	dir := t.TempDir()
+	storeDir := filepath.Join(dir, "users")
+	store, err := NewFileUserStore(storeDir)
+	if err != nil {
+		t.Fatalf("NewFileUserStore: %v", err)
+	}
+	userStore = store
+
+	rec := httptest.NewRecorder()
+	handleRegister(rec, httptest.NewRequest(http.MethodPost, "/register?name=../evil&password=s3cret", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected a path-traversal name to be rejected with 400, got %d", rec.Code)
+	}
+	if _, err := store.UserRead("../evil"); err == nil {
+		t.Fatal("expected no account to be created for a path-traversal name")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil.json")); !os.IsNotExist(err) {
+		t.Fatal("expected the rejected name to never escape the store's directory")
+	}
+}
+
+func TestBuildReportComputesAccuracyAndHistogram(t *testing.T) {
+	u := &User{Name: "ada"}
+	u.OpStats[ADD] = OpStat{Attempts: 4, Correct: 3, DurationsMs: []int64{500, 2500, 12000}}
+
+	report := buildReport(u)
+	add := report.Ops[ADD]
+	if add.Accuracy != 75 {
+		t.Fatalf("expected 75%% accuracy, got %v", add.Accuracy)
+	}
+
+	counts := map[string]int{}
+	for _, b := range add.Histogram {
+		counts[b.Label] = b.Count
+	}
+	if counts["<2s"] != 1 || counts["2-5s"] != 1 || counts[">10s"] != 1 {
+		t.Fatalf("unexpected histogram buckets: %+v", add.Histogram)
+	}
+}
@@ -6,18 +6,26 @@ package main
 import (
 	"fmt"
 	"html/template"
-	"math/rand"
 	"net/http"
 	"strconv"
-	"sync"
 	"time"
 )
 
 const (
-	// The name of cookie that identifies a "session"
-	cookieName = "myCookie"
+	// the cookie name and store settings used when no config file is
+	// found, so the server still starts for local development
+	defaultCookieName = "myCookie"
+
 	// how many facts requests in a "session"
 	maxNumQuestions = 150
+
+	// path to the session store config, relative to the working
+	// directory the server is started from
+	configPath = "session.json"
+
+	// default directory for the file-backed UserStore, used when the
+	// config doesn't set one
+	defaultUserStoreDir = "users"
 )
 
 // operator of a fact question, can be "+", "-", or "*"
@@ -31,279 +39,326 @@ const (
 	NUMOPS
 )
 
-// uniquely identify a user session
-type Session struct {
-	// sesion start time stamp
-	start time.Time
-
-	// random source
-	s rand.Source
-
-	// indicate if the user give incorrect answer before
-	firstError bool
+// owns the session store used by every handler
+var manager *Manager
 
-	// operands
-	x, y int
+// owns persistent accounts and their cross-session progress
+var userStore UserStore
 
-	// operator
-	ops Operator
-
-	// total number of errors
-	errors int
-
-	// total number of questions
-	total int
-
-	// cookie of this session
-	cookie string
+// opSymbol returns the printable symbol for op.
+func opSymbol(op Operator) string {
+	switch op {
+	case ADD:
+		return "+"
+	case SUB:
+		return "-"
+	case MUL:
+		return "*"
+	default:
+		panic("Bad ops value")
+	}
 }
 
-// template parameters for question page
-type QuestionPage struct {
-	// operands
-	X, Y int
-
-	// string representation of operator
-	Opstr string
+// render one question page, consuming any flash messages queued for it
+func EmitQuestion(w http.ResponseWriter, s *Session) {
+	page := QuestionPage{
+		X:       s.x,
+		Y:       s.y,
+		Opstr:   opSymbol(s.ops),
+		Total:   s.total,
+		Errors:  s.errors,
+		Flashes: s.Flashes(),
+	}
 
-	// total number of questions so far
-	Total int
+	t, err := template.ParseFiles("question.html")
+	if err != nil {
+		fmt.Println("Fails to parse template file:", err)
+		return
+	}
 
-	// total number of errors made so far
-	Errors int
+	err = t.Execute(w, page)
+	if err != nil {
+		fmt.Println("Fails to run html template:", err)
+	}
 }
 
-// template parameters for welcome page
-type WelcomePage struct {
-	NumFacts int
-}
+func handleNewSession(w http.ResponseWriter, r *http.Request) {
+	session, err := manager.Start(w, r)
+	if err != nil {
+		http.Error(w, "Failed to start session", http.StatusInternalServerError)
+		fmt.Println("Fails to start session:", err)
+		return
+	}
+	defer session.mu.Unlock()
 
-// create a session for new user/client
-func NewSession() *Session {
-	ts := time.Now()
-	return &Session{
-		start: ts,
-		s:     rand.NewSource(int64(ts.UnixNano())),
+	// rendering welcome page
+	t, err := template.ParseFiles("welcome.html")
+	if err != nil {
+		fmt.Println("Fails to parse template file:", err)
+	}
+
+	page := WelcomePage{NumFacts: maxNumQuestions}
+	err = t.Execute(w, page)
+	if err != nil {
+		fmt.Println("Fails to run html template:", err)
 	}
 }
 
-// return the next fact
-func (s *Session) NextInput() {
-	weight := s.s.Int63() % 11
-	switch {
-	case weight < 5:
-		s.ops = ADD
-		s.x = int(s.s.Int63() % 20)
-		s.y = int(s.s.Int63() % 20)
+func handleNextQuestion(w http.ResponseWriter, r *http.Request) {
+	session, err := manager.Start(w, r)
+	if err != nil {
+		http.Error(w, "Failed to start session", http.StatusInternalServerError)
+		fmt.Println("Fails to start session:", err)
 		return
-	case weight < 10:
-		s.ops = SUB
-		s.x = int(s.s.Int63() % 20)
-		s.y = int(s.s.Int63() % 20)
-		if s.x < s.y {
-			s.x, s.y = s.y, s.x
+	}
+
+	// Start already locked this session for us, and holds the lock for
+	// the whole validate-mutate-render critical section below, so a
+	// double-clicked submit can't race itself on total, errors,
+	// firstError, x, y, and ops - even against the file/redis providers,
+	// which hand back a fresh *Session on every read
+	defer session.mu.Unlock()
+
+	if session.user == nil && session.userName != "" {
+		// this Session was just deserialized fresh from a file/redis
+		// provider and lost its *User pointer in the round trip;
+		// reload it so syncUser keeps persisting progress past the
+		// request that logged in
+		if u, err := userStore.UserRead(session.userName); err == nil {
+			session.attachUser(u, userStore)
+		} else {
+			fmt.Println("Fails to reload user:", err)
 		}
-		return
-	case weight < 11:
-		s.ops = MUL
-		s.x = int(s.s.Int63() % 10)
-		s.y = int(s.s.Int63() % 3)
-		return
-	default:
-		panic("Should not be here")
-		return
 	}
-}
 
-var (
-	// seed for cookie
-	seed int
+	if r.Method == http.MethodPost {
+		// record the outcome as a flash and redirect to a plain GET,
+		// so refreshing the result page never resubmits the answer
+		checkAnswer(session, r.FormValue("answer"))
 
-	// a global count to ensure that cookies are different
-	count int
+		if err := session.Save(); err != nil {
+			fmt.Println("Fails to save session:", err)
+		}
+		http.Redirect(w, r, "/next", http.StatusSeeOther)
+		return
+	}
 
-	// a global lock
-	mut sync.Mutex
+	if !session.hasQuestion {
+		// generate the first question for the session
+		session.NextInput()
+		if err := session.Save(); err != nil {
+			fmt.Println("Fails to save session:", err)
+		}
+	}
 
-	// map cookies to session
-	sessionMap map[string]*Session = make(map[string]*Session)
-)
+	EmitQuestion(w, session)
+}
 
-// render one question page
-func EmitQuestion(w http.ResponseWriter, s *Session) {
-	// set cookie for response
-	c := http.Cookie{
-		Name:  cookieName,
-		Value: s.cookie,
+// checkAnswer validates strval against the session's pending fact, queuing
+// a flash describing the outcome, updating that fact's Leitner box, and
+// advancing to the next fact on a correct answer.
+func checkAnswer(session *Session, strval string) {
+	// nothing pending to validate yet
+	if !session.hasQuestion {
+		return
 	}
 
-	fmt.Println("Set cookie ", s.cookie)
-	http.SetCookie(w, &c)
-
-	page := QuestionPage{
-		X:      s.x,
-		Y:      s.y,
-		Total:  s.total,
-		Errors: s.errors,
+	val, err := strconv.Atoi(strval)
+	if err != nil {
+		return
 	}
 
-	switch s.ops {
+	var result int
+	switch session.ops {
 	case ADD:
-		page.Opstr = "+"
+		result = session.x + session.y
 	case SUB:
-		page.Opstr = "-"
+		result = session.x - session.y
 	case MUL:
-		page.Opstr = "*"
+		result = session.x * session.y
 	default:
-		panic("Bad ops value")
+		panic("Bad ops")
 	}
 
-	t, err := template.ParseFiles("question.html")
-	if err != nil {
-		fmt.Println("Fails to parse template file:", err)
+	op, x, y := session.ops, session.x, session.y
+	elapsed := time.Since(session.questionStart)
+
+	if result == val {
+		session.AddFlash("Correct!")
+		session.total++
+		if session.firstError {
+			// correct on the first try: promote the fact's box
+			session.recordAnswer(op, x, y, true)
+		}
+		session.syncUser(op, true, elapsed)
+		session.NextInput()
+		return
 	}
 
-	err = t.Execute(w, page)
-	if err != nil {
-		fmt.Println("Fails to run html template:", err)
+	session.AddFlash(fmt.Sprintf("Try again - %d%s%d is not %d", session.x, opSymbol(session.ops), session.y, val))
+	if session.firstError {
+		session.errors++
+		session.firstError = false
+		session.recordAnswer(op, x, y, false)
 	}
+	session.syncUser(op, false, elapsed)
 }
 
-func handleNewSession(w http.ResponseWriter, r *http.Request) {
-	cs := r.Cookies()
-
-	// verify that there is no cookie
-	if cs != nil {
-		for _, c := range cs {
-			// reset user cookie if it is already set
-			if c.Name == cookieName {
-				fmt.Println("already has cookie set")
-			}
-		}
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	session, err := manager.Start(w, r)
+	if err != nil {
+		http.Error(w, "Failed to start session", http.StatusInternalServerError)
+		fmt.Println("Fails to start session:", err)
+		return
 	}
 
-	// create a unique cookie value
-	mut.Lock()
-	cookieValue := fmt.Sprintf("%d:%d", seed, count)
-	count++
-	mut.Unlock()
+	// Start already locked this session for us
+	page := session.Stats()
+	session.mu.Unlock()
 
-	fmt.Println("cookie is ", cookieValue)
+	t, err := template.ParseFiles("stats.html")
+	if err != nil {
+		fmt.Println("Fails to parse template file:", err)
+		return
+	}
 
-	// add cookie into map
-	session := NewSession()
-	mut.Lock()
-	session.cookie = cookieValue
-	sessionMap[cookieValue] = session
-	mut.Unlock()
+	if err := t.Execute(w, page); err != nil {
+		fmt.Println("Fails to run html template:", err)
+	}
+}
 
-	// set cookie for the new session
-	c := http.Cookie{
-		Name:  cookieName,
-		Value: session.cookie,
+func handleRegister(w http.ResponseWriter, r *http.Request) {
+	name, password := r.FormValue("name"), r.FormValue("password")
+	if name == "" || password == "" {
+		http.Error(w, "name and password are required", http.StatusBadRequest)
+		return
+	}
+	if !validUserName.MatchString(name) {
+		http.Error(w, "name may only contain letters, digits, underscore, and hyphen", http.StatusBadRequest)
+		return
 	}
-	http.SetCookie(w, &c)
 
-	// rendering welcome page
-	t, err := template.ParseFiles("welcome.html")
+	hash, err := hashPassword(password)
 	if err != nil {
-		fmt.Println("Fails to parse template file:", err)
+		http.Error(w, "Failed to create account", http.StatusInternalServerError)
+		fmt.Println("Fails to hash password:", err)
+		return
 	}
 
-	page := WelcomePage{NumFacts: maxNumQuestions}
-	err = t.Execute(w, page)
-	if err != nil {
-		fmt.Println("Fails to run html template:", err)
+	if _, err := userStore.UserCreate(name, hash); err != nil {
+		http.Error(w, "Failed to create account", http.StatusInternalServerError)
+		fmt.Println("Fails to create user:", err)
+		return
 	}
+
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
 
-func handleNextQuestion(w http.ResponseWriter, r *http.Request) {
-	cs := r.Cookies()
-	if cs == nil || len(cs) == 0 {
-		// no cookie is detected, maybe this is the first time the user
-		// is visiting the site?
-		handleNewSession(w, r)
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	name, password := r.FormValue("name"), r.FormValue("password")
+	if !validUserName.MatchString(name) {
+		http.Error(w, "Invalid name or password", http.StatusUnauthorized)
 		return
 	}
 
-	// find cookie value
-	var cookieValue string
-	for _, c := range cs {
-		if c.Name == cookieName {
-			cookieValue = c.Value
-			break
-		}
+	user, err := authenticate(userStore, name, password)
+	if err != nil {
+		http.Error(w, "Invalid name or password", http.StatusUnauthorized)
+		return
 	}
 
-	// cookie is not properly constructed, reset and start over again
-	if len(cookieValue) == 0 {
-		handleNewSession(w, r)
+	session, err := manager.Start(w, r)
+	if err != nil {
+		http.Error(w, "Failed to start session", http.StatusInternalServerError)
+		fmt.Println("Fails to start session:", err)
 		return
 	}
 
-	// lookup stored session
-	mut.Lock()
-	session, found := sessionMap[cookieValue]
-	mut.Unlock()
+	// Start already locked this session for us
+	session.hydrateUser(user, userStore)
+	err = session.Save()
+	session.mu.Unlock()
+	if err != nil {
+		fmt.Println("Fails to save session:", err)
+	}
 
-	if !found {
-		handleNewSession(w, r)
+	http.Redirect(w, r, "/next", http.StatusSeeOther)
+}
+
+// handleReport is a parent-facing view of one child's cumulative progress:
+// per-operator accuracy and an answer-time histogram.
+func handleReport(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("user")
+	if name == "" {
+		http.Error(w, "user is required", http.StatusBadRequest)
+		return
+	}
+	if !validUserName.MatchString(name) {
+		http.Error(w, "No such user", http.StatusNotFound)
 		return
 	}
 
-	strval := r.FormValue("answer")
-	if len(strval) == 0 && session.total != 0 {
-		handleNewSession(w, r)
+	user, err := userStore.UserRead(name)
+	if err != nil {
+		http.Error(w, "No such user", http.StatusNotFound)
+		fmt.Println("Fails to read user:", err)
 		return
 	}
 
-	// validate the answer if there is a previous fact
-	if session.total != 0 {
-		val, err := strconv.Atoi(strval)
-		if err == nil {
-			switch session.ops {
-			case ADD:
-				if session.x+session.y == val {
-					session.total++
-					session.firstError = true
-					session.NextInput()
-				} else if session.firstError {
-					session.errors++
-					session.firstError = false
-				}
-			case SUB:
-				if session.x-session.y == val {
-					session.total++
-					session.firstError = true
-					session.NextInput()
-				} else if session.firstError {
-					session.errors++
-					session.firstError = false
-				}
-			case MUL:
-				if session.x*session.y == val {
-					session.total++
-					session.firstError = true
-					session.NextInput()
-				} else if session.firstError {
-					session.errors++
-					session.firstError = false
-				}
-			default:
-				panic("Bad ops")
-			}
-		}
-	} else {
-		// generate the first question for the session
-		session.NextInput()
+	t, err := template.ParseFiles("report.html")
+	if err != nil {
+		fmt.Println("Fails to parse template file:", err)
+		return
 	}
 
-	EmitQuestion(w, session)
+	if err := t.Execute(w, buildReport(user)); err != nil {
+		fmt.Println("Fails to run html template:", err)
+	}
 }
 
 func main() {
-	seed = time.Now().Nanosecond()
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		fmt.Println("No session config at", configPath, "- falling back to an in-memory store:", err)
+		cfg = &Config{
+			CookieName:  defaultCookieName,
+			Provider:    "memory",
+			MaxLifetime: 3600,
+			Secret:      generateFallbackSecret(),
+		}
+	}
+
+	manager, err = NewManagerFromConfig(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	userStoreDir := cfg.UserStoreDir
+	if userStoreDir == "" {
+		userStoreDir = defaultUserStoreDir
+	}
+	userStore, err = NewFileUserStore(userStoreDir)
+	if err != nil {
+		panic(err)
+	}
+
 	http.HandleFunc("/", handleNewSession)
 	http.HandleFunc("/next", handleNextQuestion)
+	http.HandleFunc("/stats", handleStats)
+	http.HandleFunc("/register", handleRegister)
+	http.HandleFunc("/login", handleLogin)
+	http.HandleFunc("/report", handleReport)
 	http.ListenAndServe(":8080", nil)
 }
+
+// generateFallbackSecret gives the server a usable HMAC secret when no
+// config file supplies one. It is only meant for local development: a real
+// deployment should set "secret" in session.json so restarts don't
+// invalidate every outstanding cookie.
+func generateFallbackSecret() string {
+	secret, err := generateSessionID()
+	if err != nil {
+		panic(err)
+	}
+	return secret
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// testConcurrentSameCookie fires many concurrent /next requests carrying the
+// same session cookie and the same correct answer, simulating a
+// double-clicked submit. Without the per-sid lock held across the whole
+// validate-mutate-render section, every goroutine can read the pending
+// fact before any of them advances it, double-counting the same correct
+// answer; with it held, exactly one should win. This is run against every
+// SessionProvider: file and redis hand back a brand new *Session on every
+// read, so the fix must serialize at the Manager/sid level, not merely on
+// the Session object a single provider happens to keep shared in memory.
+func testConcurrentSameCookie(t *testing.T, provider SessionProvider) {
+	manager = NewManager(provider, "myCookie", 3600, "test-secret", false)
+
+	const sid = "test-sid"
+	sess, err := manager.provider.SessionInit(sid)
+	if err != nil {
+		t.Fatalf("SessionInit: %v", err)
+	}
+	sess.ops = ADD
+	sess.x, sess.y = 3, 4
+	sess.total = 1
+	sess.firstError = true
+	sess.hasQuestion = true
+	// pre-seed a second fact that is already due, so the winning
+	// goroutine's NextInput deterministically advances to it instead of
+	// sampling a random fact that might, by chance, also sum to the same
+	// answer submitted below and mask a double count
+	sess.facts[factKey{SUB, 19, 0}] = &FactRecord{Op: SUB, X: 19, Y: 0, Box: 1, DueAt: 1}
+	if err := manager.provider.SessionUpdate(sess); err != nil {
+		t.Fatalf("SessionUpdate: %v", err)
+	}
+
+	cookie := &http.Cookie{Name: manager.cookieName, Value: manager.sign(sid)}
+	answer := fmt.Sprintf("%d", sess.x+sess.y)
+
+	const concurrency = 20
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/next?answer="+answer, nil)
+			req.AddCookie(cookie)
+			handleNextQuestion(httptest.NewRecorder(), req)
+		}()
+	}
+	wg.Wait()
+
+	final, err := manager.provider.SessionRead(sid)
+	if err != nil {
+		t.Fatalf("SessionRead: %v", err)
+	}
+	if final.total != 2 {
+		t.Fatalf("expected the shared correct answer to be counted exactly once (total=2), got total=%d", final.total)
+	}
+}
+
+func TestHandleNextQuestionConcurrentSameCookie(t *testing.T) {
+	testConcurrentSameCookie(t, NewMemProvider())
+}
+
+// TestHandleNextQuestionConcurrentSameCookieFileProvider is the same race
+// against FileProvider, which deserializes a fresh *Session on every
+// SessionRead: a lock on that Session object alone cannot prevent a lost
+// update, since two such objects for the same sid never share a mutex.
+func TestHandleNextQuestionConcurrentSameCookieFileProvider(t *testing.T) {
+	provider, err := NewFileProvider(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileProvider: %v", err)
+	}
+	testConcurrentSameCookie(t, provider)
+}